@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"go.bug.st/serial"
+)
+
+// telnetコマンドバイト（RFC 854）
+const (
+	telnetIAC  byte = 255
+	telnetDONT byte = 254
+	telnetDO   byte = 253
+	telnetWONT byte = 252
+	telnetWILL byte = 251
+	telnetSB   byte = 250
+	telnetSE   byte = 240
+)
+
+// RFC 2217 COM-PORT-OPTIONのオプション番号とサブコマンド
+const (
+	comPortOption byte = 44
+
+	cpoSetBaudrate byte = 1
+	cpoSetDatasize byte = 2
+	cpoSetParity   byte = 3
+	cpoSetStopsize byte = 4
+)
+
+// modeSetter はRFC2217のサブネゴシエーションから呼ばれる、ポートのモード変更手段。
+// managedConnがこれを満たす。
+type modeSetter interface {
+	SetMode(mode *serial.Mode) error
+}
+
+// telnetFilter はtelnetのIAC/オプションネゴシエーションをデータストリームから
+// 取り除き、平文データのみを取り出す簡易ステートマシン。COM-PORT-OPTIONの
+// サブネゴシエーション本体はonSubnegotiationに渡す。
+type telnetFilter struct {
+	state            int
+	subOpt           []byte
+	onSubnegotiation func(sub []byte)
+}
+
+const (
+	tfNormal = iota
+	tfIAC
+	tfSubneg
+	tfSkipOption
+	tfSubnegIAC
+)
+
+func newTelnetFilter(onSubnegotiation func(sub []byte)) *telnetFilter {
+	return &telnetFilter{onSubnegotiation: onSubnegotiation}
+}
+
+// feed はクライアントから受け取った生バイト列を処理し、シリアルポートへ転送すべき
+// 平文データを返す。
+func (t *telnetFilter) feed(in []byte) []byte {
+	out := make([]byte, 0, len(in))
+
+	for _, b := range in {
+		switch t.state {
+		case tfNormal:
+			if b == telnetIAC {
+				t.state = tfIAC
+			} else {
+				out = append(out, b)
+			}
+		case tfIAC:
+			switch b {
+			case telnetIAC:
+				out = append(out, telnetIAC)
+				t.state = tfNormal
+			case telnetSB:
+				t.subOpt = t.subOpt[:0]
+				t.state = tfSubneg
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				t.state = tfSkipOption
+			default:
+				t.state = tfNormal
+			}
+		case tfSkipOption:
+			// WILL/WONT/DO/DONTに続くオプション番号を読み捨てる
+			t.state = tfNormal
+		case tfSubneg:
+			if b == telnetIAC {
+				t.state = tfSubnegIAC
+			} else {
+				t.subOpt = append(t.subOpt, b)
+			}
+		case tfSubnegIAC:
+			if b == telnetSE {
+				if t.onSubnegotiation != nil && len(t.subOpt) >= 1 && t.subOpt[0] == comPortOption {
+					t.onSubnegotiation(t.subOpt[1:])
+				}
+				t.state = tfNormal
+			} else {
+				// サブネゴシエーション本体中のエスケープされたIAC
+				t.subOpt = append(t.subOpt, b)
+				t.state = tfSubneg
+			}
+		}
+	}
+
+	return out
+}
+
+// bridgeServer は-listenで起動するRFC2217/raw TCPブリッジ。単一の物理シリアル
+// ポートを複数のリモートクライアント（socat, picocom等）に同時に見せる。
+type bridgeServer struct {
+	mu      sync.Mutex
+	clients map[net.Conn]struct{}
+	mode    serial.Mode
+
+	send   func([]byte)
+	setter modeSetter
+}
+
+// newBridgeServer はbridgeServerを作成する。sendはクライアントから受信したデータを
+// シリアルポートへ書き込む経路（インタラクティブセッションと共通）。
+func newBridgeServer(send func([]byte), setter modeSetter, initialMode serial.Mode) *bridgeServer {
+	return &bridgeServer{
+		clients: make(map[net.Conn]struct{}),
+		mode:    initialMode,
+		send:    send,
+		setter:  setter,
+	}
+}
+
+// Listen はaddrで接続を待ち受け、以後acceptしたクライアントをhandleClientで処理する。
+func (b *bridgeServer) Listen(addr string) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			b.handleClient(conn)
+		}
+	}()
+	return ln, nil
+}
+
+// Broadcast はシリアルポートから受信したデータを接続中の全クライアントに転送する。
+func (b *bridgeServer) Broadcast(data []byte) {
+	escaped := escapeTelnetIAC(data)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.clients {
+		c.SetWriteDeadline(time.Now().Add(2 * time.Second))
+		if _, err := c.Write(escaped); err != nil {
+			c.Close()
+			delete(b.clients, c)
+		}
+	}
+}
+
+// escapeTelnetIACはdata中の0xFFバイトをIAC IACにエスケープする。telnetモードの
+// クライアントへ生のシリアルデータを送る前に必要で、feedが行うIAC IACの復元
+// （クライアント→サーバ方向）と対になる。
+func escapeTelnetIAC(data []byte) []byte {
+	n := 0
+	for _, b := range data {
+		if b == telnetIAC {
+			n++
+		}
+	}
+	if n == 0 {
+		return data
+	}
+
+	out := make([]byte, 0, len(data)+n)
+	for _, b := range data {
+		out = append(out, b)
+		if b == telnetIAC {
+			out = append(out, telnetIAC)
+		}
+	}
+	return out
+}
+
+func (b *bridgeServer) handleClient(conn net.Conn) {
+	b.mu.Lock()
+	b.clients[conn] = struct{}{}
+	b.mu.Unlock()
+
+	// COM-PORT-OPTIONに対応していることをクライアントに提示する
+	conn.Write([]byte{telnetIAC, telnetWILL, comPortOption})
+
+	go func() {
+		defer func() {
+			b.mu.Lock()
+			delete(b.clients, conn)
+			b.mu.Unlock()
+			conn.Close()
+		}()
+
+		filter := newTelnetFilter(b.applyComPortOption)
+
+		buf := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			data := filter.feed(buf[:n])
+			if len(data) > 0 && b.send != nil {
+				b.send(data)
+			}
+		}
+	}()
+}
+
+// applyComPortOption はRFC2217 COM-PORT-OPTIONのサブネゴシエーションを解釈し、
+// setter.SetModeを通じて実際のシリアルポートに反映する。
+func (b *bridgeServer) applyComPortOption(sub []byte) {
+	if len(sub) < 2 || b.setter == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch sub[0] {
+	case cpoSetBaudrate:
+		if len(sub) >= 5 {
+			if baud := int(binary.BigEndian.Uint32(sub[1:5])); baud > 0 {
+				b.mode.BaudRate = baud
+			}
+		}
+	case cpoSetDatasize:
+		b.mode.DataBits = int(sub[1])
+	case cpoSetParity:
+		b.mode.Parity = rfc2217Parity(sub[1])
+	case cpoSetStopsize:
+		b.mode.StopBits = rfc2217StopBits(sub[1])
+	default:
+		return
+	}
+
+	b.setter.SetMode(&b.mode)
+}
+
+// rfc2217Parity はRFC2217のPARITYコードをserial.Parityに変換する。
+func rfc2217Parity(code byte) serial.Parity {
+	switch code {
+	case 1:
+		return serial.NoParity
+	case 2:
+		return serial.OddParity
+	case 3:
+		return serial.EvenParity
+	case 4:
+		return serial.MarkParity
+	case 5:
+		return serial.SpaceParity
+	}
+	return serial.NoParity
+}
+
+// rfc2217StopBits はRFC2217のSTOPSIZEコードをserial.StopBitsに変換する。
+func rfc2217StopBits(code byte) serial.StopBits {
+	switch code {
+	case 1:
+		return serial.OneStopBit
+	case 2:
+		return serial.TwoStopBits
+	case 3:
+		return serial.OnePointFiveStopBits
+	}
+	return serial.OneStopBit
+}
+
+// runBridgeClient は `-connect host:port` で指定されたブリッジサーバーにTCP接続し、
+// ローカルのセッションペインと同じ操作感で表示・入力できるようにする。
+func runBridgeClient(app *tview.Application, addr string) error {
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("接続できませんでした: %v", err)
+	}
+
+	pane := newSessionPane(app)
+	pane.SetTitle(fmt.Sprintf(" リモート: %s (Ctrl-B: live/scroll切替) ", addr))
+
+	pane.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Key() == tcell.KeyCtrlB:
+			pane.toggleMode()
+			return nil
+		case pane.mode == modeScroll && event.Key() == tcell.KeyPgUp:
+			row, _ := pane.GetScrollOffset()
+			pane.ScrollTo(row-10, 0)
+			return nil
+		case pane.mode == modeScroll && event.Key() == tcell.KeyPgDn:
+			row, _ := pane.GetScrollOffset()
+			pane.ScrollTo(row+10, 0)
+			return nil
+		}
+
+		if event.Key() == tcell.KeyEnter {
+			nc.Write([]byte{'\r'})
+			return nil
+		}
+		if event.Rune() != 0 {
+			nc.Write([]byte(string(event.Rune())))
+			return nil
+		}
+		if b, ok := ctrlKeyBytes(event.Key()); ok {
+			nc.Write(b)
+			return nil
+		}
+		return event
+	})
+
+	app.SetRoot(pane, true).SetFocus(pane)
+
+	go func() {
+		// サーバー（bridgeServer.handleClient）は接続直後にIAC WILL
+		// COM-PORT-OPTIONを送り、以後Broadcastで0xFFをIAC IACにエスケープ
+		// した生データを送ってくる。telnetFilterで両方を取り除き、平文だけを
+		// ペインに書き込む。
+		filter := newTelnetFilter(nil)
+
+		buf := make([]byte, 1024)
+		for {
+			n, err := nc.Read(buf)
+			if err != nil {
+				return
+			}
+			if n > 0 {
+				if data := filter.feed(buf[:n]); len(data) > 0 {
+					pane.Write(data)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
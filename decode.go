@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"golang.org/x/text/transform"
+)
+
+// decodeChunk は受信した生バイト列をエンコーディング変換する。インタラクティブ
+// セッションとexpect/sendエンジンの両方から呼ばれる共通処理で、変換に失敗した
+// 場合は元のバイト列をそのまま返す。
+func decodeChunk(raw []byte, transformer transform.Transformer) []byte {
+	if transformer == nil {
+		return raw
+	}
+	decoded, err := io.ReadAll(transform.NewReader(bytes.NewReader(raw), transformer))
+	if err != nil || len(decoded) == 0 {
+		return raw
+	}
+	return decoded
+}
+
+// stripANSI はCSIエスケープシーケンス（ANSI/VT100のSGRやカーソル制御）を取り除き、
+// expectのパターンマッチングに使うプレーンテキストを得る。
+func stripANSI(s string) string {
+	var b strings.Builder
+	inEsc := false
+	inCSI := false
+	for _, r := range s {
+		if inCSI {
+			if r >= '@' && r <= '~' {
+				inCSI = false
+			}
+			continue
+		}
+		if inEsc {
+			inEsc = false
+			if r == '[' {
+				inCSI = true
+			}
+			continue
+		}
+		if r == 0x1b {
+			inEsc = true
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
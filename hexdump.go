@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// hexDumper はhexモードでの現在の読み取りオフセットを保持する。
+// 接続開始時とCtrl-Xでhexモードを切り替えるたびに新しく作られ、0から数え直す。
+//
+// シリアルの読み取りは16バイト境界に揃っているとは限らないため、端数は
+// pendingに蓄えて次回のdump呼び出しに持ち越す。こうすることで、捕手側の
+// port.Read()の分割の仕方によらず、行がストリーム上のバイト列と一致した
+// hexダンプになる（他ツールのキャプチャと突き合わせる用途が前提のため）。
+type hexDumper struct {
+	offset  int
+	pending []byte
+}
+
+// newHexDumper は新しいhexモード用の変換器を作成する。
+func newHexDumper() *hexDumper {
+	return &hexDumper{}
+}
+
+// dump はencoding/hexのDump関数と同じレイアウト（オフセット、16バイトの16進数、ASCIIガター）で
+// dataをフォーマットする。Dumpとの違いは、呼び出しをまたいでオフセットを維持する点と、
+// 16バイトに満たない端数を次回の呼び出しに持ち越す点。
+func (h *hexDumper) dump(data []byte) []byte {
+	h.pending = append(h.pending, data...)
+
+	var b strings.Builder
+	for len(h.pending) >= 16 {
+		h.writeRow(&b, h.pending[:16])
+		h.pending = h.pending[16:]
+	}
+
+	return []byte(b.String())
+}
+
+// Flush はpendingに残っている16バイト未満の端数を、不足分を空白で埋めた
+// 行として出力する。hexモードを抜けるときや読み込みループの終了時に呼び、端数を読み手から
+// 見えなくしてしまわないようにする。デバイスの抜線では読み込みループは終わらないため
+// 呼ばれず、端数は再接続後に受信したデータと続けて出力される。
+func (h *hexDumper) Flush() []byte {
+	if len(h.pending) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	h.writeRow(&b, h.pending)
+	h.pending = nil
+
+	return []byte(b.String())
+}
+
+func (h *hexDumper) writeRow(b *strings.Builder, chunk []byte) {
+	fmt.Fprintf(b, "%08x  ", h.offset)
+
+	for j := 0; j < 16; j++ {
+		if j < len(chunk) {
+			fmt.Fprintf(b, "%02x ", chunk[j])
+		} else {
+			b.WriteString("   ")
+		}
+		if j == 7 {
+			b.WriteByte(' ')
+		}
+	}
+
+	b.WriteString(" |")
+	for _, c := range chunk {
+		if c >= 32 && c <= 126 {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('.')
+		}
+	}
+	b.WriteString("|\n")
+
+	h.offset += len(chunk)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
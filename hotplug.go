@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rjeczalik/notify"
+	"go.bug.st/serial"
+	"go.bug.st/serial/enumerator"
+)
+
+// 再接続ポーリングの間隔（notifyが使えない環境でのフォールバック）
+const reconnectPollInterval = time.Second
+
+// portIdentity はホットプラグ時に同一デバイスを再検出するための識別情報。
+// ポート名（/dev/ttyUSB0など）はOSの割り当て次第で変わりうるため、
+// USBのVID/PID/シリアル番号で突き合わせる。
+type portIdentity struct {
+	VID          string
+	PID          string
+	SerialNumber string
+}
+
+// identifyPort は指定のポート名に対応するUSB識別情報を取得する。
+// USBデバイスでない場合はokがfalseになる。
+func identifyPort(portName string) (identity portIdentity, ok bool) {
+	ports, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		return portIdentity{}, false
+	}
+	for _, p := range ports {
+		if p.Name == portName && p.IsUSB {
+			return portIdentity{VID: p.VID, PID: p.PID, SerialNumber: p.SerialNumber}, true
+		}
+	}
+	return portIdentity{}, false
+}
+
+// findMatchingPort はidentityに一致するUSBシリアルデバイスが現在接続されていれば
+// そのポート名を返す。
+func findMatchingPort(identity portIdentity) (string, bool) {
+	ports, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		return "", false
+	}
+	for _, p := range ports {
+		if p.IsUSB && p.VID == identity.VID && p.PID == identity.PID &&
+			p.SerialNumber == identity.SerialNumber {
+			return p.Name, true
+		}
+	}
+	return "", false
+}
+
+// isSerialDevicePath はパスがシリアルデバイスの命名規則（ttyUSB*, ttyACM*, cu.*など）に
+// 合致するかどうかを判定する。notifyは/dev配下のすべての変化を通知してくるため、
+// 無関係なイベントで再スキャンが走らないようにするためのフィルタ。
+func isSerialDevicePath(path string) bool {
+	base := path
+	if idx := strings.LastIndex(path, "/"); idx >= 0 {
+		base = path[idx+1:]
+	}
+	return strings.HasPrefix(base, "ttyUSB") ||
+		strings.HasPrefix(base, "ttyACM") ||
+		strings.HasPrefix(base, "cu.") ||
+		strings.HasPrefix(base, "tty.")
+}
+
+// startDeviceWatch は/dev配下のファイル作成・削除を監視し、シリアルデバイスらしい
+// パスの変化があるたびにonChangeを呼び出す。Windowsではnotifyの対応が限定的なため、
+// 監視の開始に失敗した場合はログに記録するだけで、呼び出し元は単に一覧の即時更新が
+// 効かなくなる（後述のポーリングにフォールバックする箇所もある）。
+func startDeviceWatch(onChange func()) (stop func()) {
+	events := make(chan notify.EventInfo, 16)
+	if err := notify.Watch("/dev/...", events, notify.Create, notify.Remove); err != nil {
+		log.Printf("デバイス監視を開始できませんでした: %v", err)
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case ev := <-events:
+				if isSerialDevicePath(ev.Path()) {
+					onChange()
+				}
+			case <-done:
+				notify.Stop(events)
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// managedConn はホットプラグに対応したシリアルポート接続。
+// 物理デバイスが抜かれるとReadがエラーを返す代わりに"切断"状態になり、
+// 同一のVID/PID/シリアル番号を持つデバイスが再度現れると自動で再接続する。
+// USBの識別情報が取得できなかったポートは切断状態のまま再接続しない。
+type managedConn struct {
+	mu       sync.Mutex
+	port     serial.Port
+	mode     serial.Mode
+	identity portIdentity
+	hasIdent bool
+	portName string
+
+	// onStatus は接続状態が変化したとき（切断／再接続）に呼ばれる。nilでもよい。
+	onStatus func(connected bool, portName string)
+}
+
+// newManagedConn はportNameを開いて接続を確立する。
+func newManagedConn(portName string, mode serial.Mode, onStatus func(connected bool, portName string)) (*managedConn, error) {
+	port, err := serial.Open(portName, &mode)
+	if err != nil {
+		return nil, err
+	}
+	port.SetReadTimeout(time.Millisecond * 10)
+
+	identity, hasIdent := identifyPort(portName)
+
+	return &managedConn{
+		port:     port,
+		mode:     mode,
+		identity: identity,
+		hasIdent: hasIdent,
+		portName: portName,
+		onStatus: onStatus,
+	}, nil
+}
+
+// Write は現在の接続にバイト列を書き込む。切断中は何も送らずエラーを返す。
+func (c *managedConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	port := c.port
+	c.mu.Unlock()
+	if port == nil {
+		return 0, fmt.Errorf("ポートが切断されています")
+	}
+	return port.Write(p)
+}
+
+// Read は現在の接続から読み込む。切断を検出した場合はmarkDisconnectedを呼び、
+// 呼び出し元のループを止めないようn=0, err=nilを返す（完全な切断はCloseで行う）。
+func (c *managedConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	port := c.port
+	c.mu.Unlock()
+
+	if port == nil {
+		time.Sleep(reconnectPollInterval)
+		return 0, nil
+	}
+
+	n, err := port.Read(p)
+	if err != nil && err != io.EOF && !strings.Contains(err.Error(), "timeout") {
+		c.markDisconnected()
+		return 0, nil
+	}
+	return n, nil
+}
+
+// markDisconnected は現在のポートを閉じ、USBの識別情報があれば再接続ループを開始する。
+func (c *managedConn) markDisconnected() {
+	c.mu.Lock()
+	if c.port == nil {
+		c.mu.Unlock()
+		return
+	}
+	c.port.Close()
+	c.port = nil
+	portName := c.portName
+	c.mu.Unlock()
+
+	if c.onStatus != nil {
+		c.onStatus(false, portName)
+	}
+
+	if c.hasIdent {
+		go c.reconnectLoop()
+	}
+}
+
+// reconnectLoop はidentityに一致するデバイスが再接続されるまで待ち受ける。
+// notifyによる即時検知と、対応していない環境向けのポーリングを併用する。
+func (c *managedConn) reconnectLoop() {
+	stop := startDeviceWatch(func() { c.tryReconnect() })
+	defer stop()
+
+	ticker := time.NewTicker(reconnectPollInterval)
+	defer ticker.Stop()
+
+	for {
+		c.mu.Lock()
+		connected := c.port != nil
+		c.mu.Unlock()
+		if connected {
+			return
+		}
+
+		c.tryReconnect()
+		<-ticker.C
+	}
+}
+
+// tryReconnect はidentityに一致するデバイスが見つかれば一度だけ再接続を試みる。
+func (c *managedConn) tryReconnect() {
+	c.mu.Lock()
+	if c.port != nil {
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+
+	name, ok := findMatchingPort(c.identity)
+	if !ok {
+		return
+	}
+
+	port, err := serial.Open(name, &c.mode)
+	if err != nil {
+		return
+	}
+	port.SetReadTimeout(time.Millisecond * 10)
+
+	c.mu.Lock()
+	c.port = port
+	c.portName = name
+	c.mu.Unlock()
+
+	if c.onStatus != nil {
+		c.onStatus(true, name)
+	}
+}
+
+// SetMode は現在の接続にモード変更（ボーレートなど）を適用する。RFC2217の
+// COM-PORT-OPTIONネゴシエーションから呼ばれる。切断中はエラーを返す。
+func (c *managedConn) SetMode(mode *serial.Mode) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.port == nil {
+		return fmt.Errorf("ポートが切断されています")
+	}
+	c.mode = *mode
+	return c.port.SetMode(mode)
+}
+
+// Close は現在の接続を閉じる。再接続待機中であればそのまま何もしない。
+func (c *managedConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.port == nil {
+		return nil
+	}
+	return c.port.Close()
+}
@@ -4,12 +4,13 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
-	"io"
 	"log"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
@@ -44,6 +45,9 @@ type SerialConfig struct {
 	Encoding           encoding.Encoding
 	EncodingName       string
 	LogFile            string // ログファイルのパス
+	HexMode            bool   // trueの場合、受信データをhex.Dump形式で表示・記録する
+	RecordPath         string // 指定するとscriptreplay互換＋フレーム形式でセッションを記録する
+	ListenAddr         string // 指定するとRFC2217/raw TCPブリッジとしてこのポートを公開する
 }
 
 // デフォルト設定
@@ -59,6 +63,9 @@ func DefaultConfig() SerialConfig {
 		Encoding:           encoding.Nop, // デフォルトはUTF-8
 		EncodingName:       "UTF-8",
 		LogFile:            "", // デフォルトはログなし
+		HexMode:            false,
+		RecordPath:         "", // デフォルトは記録なし
+		ListenAddr:         "", // デフォルトはブリッジ無効
 	}
 }
 
@@ -260,8 +267,9 @@ func autoNegotiate(portName string, originalConfig SerialConfig) (SerialConfig,
 	return config, nil
 }
 
-// シリアルポートに接続してインタラクティブモードを開始
-func connectToPort(config SerialConfig) error {
+// シリアルポートに接続してインタラクティブモードを開始。
+// tviewアプリケーションは停止せず、セッションペインに差し替えてTUI内で表示を続ける。
+func connectToPort(app *tview.Application, config SerialConfig) error {
 	var logFile *os.File
 	var err error
 
@@ -280,7 +288,6 @@ func connectToPort(config SerialConfig) error {
 		if err != nil {
 			return fmt.Errorf("ログファイルを開けませんでした: %v", err)
 		}
-		defer logFile.Close()
 
 		// ログファイルにセッション開始情報を書き込む
 		timestamp := time.Now().Format("2006-01-02 15:04:05")
@@ -288,51 +295,165 @@ func connectToPort(config SerialConfig) error {
 		logFile.WriteString(fmt.Sprintf("ポート: %s, ボーレート: %d, エンコーディング: %s\n\n",
 			config.PortName, config.BaudRate, config.EncodingName))
 	}
-	// ポートを開く
-	port, err := serial.Open(config.PortName, &serial.Mode{
+	// ポートを開く（抜線を検知して同一デバイスの再接続を待つmanagedConn経由）
+	mode := serial.Mode{
 		BaudRate: config.BaudRate,
 		DataBits: config.DataBits,
 		Parity:   config.Parity,
 		StopBits: config.StopBits,
-	})
-
+	}
+	conn, err := newManagedConn(config.PortName, mode, nil)
 	if err != nil {
+		if logFile != nil {
+			logFile.Close()
+		}
 		return fmt.Errorf("ポートを開けませんでした: %v", err)
 	}
 
-	defer port.Close()
+	// 記録が指定されている場合はscriptreplay互換ファイル＋フレーム形式で記録する
+	var recorder *sessionRecorder
+	if config.RecordPath != "" {
+		recorder, err = newSessionRecorder(config.RecordPath)
+		if err != nil {
+			conn.Close()
+			if logFile != nil {
+				logFile.Close()
+			}
+			return err
+		}
+	}
+
+	// セッションペインとレイアウトを構築し、ポート選択フォームと入れ替える
+	pane := newSessionPane(app)
+	searchBar := tview.NewInputField().
+		SetLabel("検索: ")
+	pane.searchBar = searchBar
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(pane, 0, 1, true)
+
+	// searchBarはCtrl-Bやフォーカス変更のたびにAddItemし直すと二重に積まれて
+	// レイアウトが崩れるため、表示中かどうかをここで追跡する
+	searchVisible := false
+	hideSearchBar := func() {
+		if searchVisible {
+			layout.RemoveItem(searchBar)
+			searchVisible = false
+		}
+	}
+	searchBar.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEnter {
+			pane.search(searchBar.GetText())
+		}
+		hideSearchBar()
+		app.SetFocus(pane)
+	})
 
-	// 接続情報を表示
-	fmt.Printf("\n接続しました: %s (ボーレート: %d, データビット: %d)\n",
-		config.PortName, config.BaudRate, config.DataBits)
-	fmt.Println("終了するには Ctrl+C を押してください")
+	// デバイス抜線/再接続をペインのタイトルに反映する
+	conn.onStatus = func(connected bool, portName string) {
+		app.QueueUpdateDraw(func() {
+			if connected {
+				pane.setConnected(true, portName)
+			} else {
+				pane.setConnected(false, portName)
+			}
+		})
+	}
 
-	// 非ブロッキングモードに設定
-	port.SetReadTimeout(time.Millisecond * 10)
+	// hexModeはUIゴルーチン(Ctrl-X)と読み込みゴルーチンの両方から参照されるためatomicにする
+	var hexMode int32
+	if config.HexMode {
+		hexMode = 1
+	}
+	var dumper atomic.Value
+	dumper.Store(newHexDumper())
+
+	// send はローカルのキー入力とRFC2217/rawブリッジのリモートクライアントの
+	// 両方から共通で使うシリアル送信経路。記録が有効な場合はTXとしても記録する。
+	send := func(b []byte) {
+		conn.Write(b)
+		if recorder != nil {
+			recorder.RecordTX(b)
+		}
+	}
 
-	// ユーザー入力を処理するゴルーチン
-	go func() {
-		buf := make([]byte, 1)
-		for {
-			n, err := os.Stdin.Read(buf)
-			if err != nil || n == 0 {
-				continue
+	// -listenが指定されている場合、このポートをRFC2217/raw TCPブリッジとして公開する
+	var bridge *bridgeServer
+	var listener net.Listener
+	if config.ListenAddr != "" {
+		bridge = newBridgeServer(send, conn, mode)
+		listener, err = bridge.Listen(config.ListenAddr)
+		if err != nil {
+			if recorder != nil {
+				recorder.Close()
 			}
+			conn.Close()
+			if logFile != nil {
+				logFile.Close()
+			}
+			return fmt.Errorf("ブリッジの待ち受けに失敗しました: %v", err)
+		}
+		pane.SetTitle(fmt.Sprintf(" セッション: %s [公開中: %s] ", config.PortName, config.ListenAddr))
+	}
 
-			_, err = port.Write(buf[:n])
-			if err != nil {
-				log.Printf("書き込みエラー: %v", err)
-				return
+	pane.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Key() == tcell.KeyCtrlB:
+			pane.toggleMode()
+			if pane.mode != modeScroll {
+				hideSearchBar()
 			}
+			return nil
+		case event.Key() == tcell.KeyCtrlX:
+			turningOff := atomic.LoadInt32(&hexMode) != 0
+			old := dumper.Load().(*hexDumper)
+			atomic.StoreInt32(&hexMode, 1-atomic.LoadInt32(&hexMode))
+			dumper.Store(newHexDumper())
+			// hexモードを抜けるときは、まだ16バイトに満たず出力されて
+			// いない端数をここで出し切ってから捨てる
+			if turningOff {
+				if flushed := old.Flush(); len(flushed) > 0 {
+					pane.Write(flushed)
+					if logFile != nil {
+						logFile.Write(flushed)
+					}
+				}
+			}
+			return nil
+		case pane.mode == modeScroll && event.Key() == tcell.KeyPgUp:
+			row, _ := pane.GetScrollOffset()
+			pane.ScrollTo(row-10, 0)
+			return nil
+		case pane.mode == modeScroll && event.Key() == tcell.KeyPgDn:
+			row, _ := pane.GetScrollOffset()
+			pane.ScrollTo(row+10, 0)
+			return nil
+		case pane.mode == modeScroll && event.Rune() == '/':
+			if !searchVisible {
+				layout.AddItem(searchBar, 1, 0, true)
+				searchVisible = true
+			}
+			app.SetFocus(searchBar)
+			return nil
 		}
-	}()
 
-	// シリアルポートからの出力を処理
-	buf := make([]byte, 1024) // より大きなバッファを使用
-	readBuf := bytes.NewBuffer(make([]byte, 0, 1024))
+		// 上記以外のキーは（スクロールモード中も）そのままシリアルポートへ転送する
+		if event.Key() == tcell.KeyEnter {
+			send([]byte{'\r'})
+			return nil
+		}
+		if event.Rune() != 0 {
+			send([]byte(string(event.Rune())))
+			return nil
+		}
+		if b, ok := ctrlKeyBytes(event.Key()); ok {
+			send(b)
+			return nil
+		}
+		return event
+	})
 
-	// 接続情報にエンコーディングを追加表示
-	fmt.Printf("エンコーディング: %s\n", config.EncodingName)
+	app.SetRoot(layout, true).SetFocus(pane)
 
 	// エンコーディング変換用のトランスフォーマー
 	var transformer transform.Transformer
@@ -340,61 +461,174 @@ func connectToPort(config SerialConfig) error {
 		transformer = config.Encoding.NewDecoder()
 	}
 
-	for {
-		n, err := port.Read(buf)
-		if err != nil && err != io.EOF && !strings.Contains(err.Error(), "timeout") {
-			return fmt.Errorf("読み込みエラー: %v", err)
-		}
+	go func() {
+		// ブリッジのリスナー・recorder・logFile・connはこのゴルーチンが
+		// セッションの実体であり、読み込みループが終わる（＝セッションが
+		// 終わる）まで閉じてはならない。connectToPort自体はUIを構築したら
+		// 即座に返るtviewのイベントループと同居しているため、ここで
+		// deferするのが正しい所有者になる。
+		defer func() {
+			// 読み込みループの終了時にhexモードの端数が残っていれば出し切ってから閉じる
+			if flushed := dumper.Load().(*hexDumper).Flush(); len(flushed) > 0 {
+				pane.Write(flushed)
+				if logFile != nil {
+					logFile.Write(flushed)
+				}
+			}
+			if listener != nil {
+				listener.Close()
+			}
+			if recorder != nil {
+				recorder.Close()
+			}
+			conn.Close()
+			if logFile != nil {
+				logFile.Close()
+			}
+		}()
+
+		buf := make([]byte, 1024)
+		readBuf := bytes.NewBuffer(make([]byte, 0, 1024))
+
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
 
-		if n > 0 {
-			// バッファに追加
-			readBuf.Write(buf[:n])
+			if n > 0 {
+				readBuf.Write(buf[:n])
 
-			// エンコーディング変換
-			var outputData []byte
-			if transformer != nil {
-				// 変換処理
-				decoded, err := io.ReadAll(transform.NewReader(readBuf, transformer))
-				if err == nil && len(decoded) > 0 {
-					outputData = decoded
+				if recorder != nil {
+					recorder.RecordRX(buf[:n])
+				}
+				if bridge != nil {
+					bridge.Broadcast(buf[:n])
+				}
+
+				var outputData []byte
+				if atomic.LoadInt32(&hexMode) != 0 {
+					// hexモードではデコードせず、受信した生バイト列をそのままダンプする
+					outputData = dumper.Load().(*hexDumper).dump(readBuf.Bytes())
 				} else {
-					// 変換エラー時は元のバイト列を使用
-					outputData = readBuf.Bytes()
+					// expect/sendエンジンと共通のデコード処理を使う
+					outputData = decodeChunk(readBuf.Bytes(), transformer)
 				}
-			} else {
-				// UTF-8の場合は変換しない
-				outputData = readBuf.Bytes()
-			}
 
-			// 標準出力に書き込み
-			os.Stdout.Write(outputData)
+				pane.Write(outputData)
 
-			// ログファイルに書き込み
-			if logFile != nil {
-				logFile.Write(outputData)
+				if logFile != nil {
+					logFile.Write(outputData)
+				}
+
+				readBuf.Reset()
 			}
 
-			// バッファをクリア
-			readBuf.Reset()
+			time.Sleep(time.Millisecond * 10)
 		}
+	}()
+
+	return nil
+}
 
-		time.Sleep(time.Millisecond * 10)
+// ctrlKeyBytes はEnter以外の制御キー（矢印キーなど）をシリアル送信用のバイト列に変換する。
+func ctrlKeyBytes(key tcell.Key) ([]byte, bool) {
+	switch key {
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		return []byte{0x08}, true
+	case tcell.KeyTab:
+		return []byte{0x09}, true
+	case tcell.KeyEsc:
+		return []byte{0x1b}, true
+	case tcell.KeyUp:
+		return []byte{0x1b, '[', 'A'}, true
+	case tcell.KeyDown:
+		return []byte{0x1b, '[', 'B'}, true
+	case tcell.KeyRight:
+		return []byte{0x1b, '[', 'C'}, true
+	case tcell.KeyLeft:
+		return []byte{0x1b, '[', 'D'}, true
+	}
+	// tcellのKeyCtrlSpace..KeyCtrlUnderscoreはCtrlチョードをASCII制御コード順に
+	// 0始まりで連番化したもの（KeyCtrlSpace=NUL, KeyCtrlA=0x01, ...）なので、
+	// Ctrl-D/Ctrl-]など個別にcaseを持たないchordもオフセットを引くだけで
+	// 正しい制御コードに変換できる。Cisco/Juniper操作で必要なログアウト等
+	// (Ctrl-D, Ctrl-Z, Ctrl-]等)もこれで転送される。Ctrl-CはtviewのApplicationが
+	// アプリケーション終了として先に処理するため、ここには届かず転送されない。
+	if key >= tcell.KeyCtrlSpace && key <= tcell.KeyCtrlUnderscore {
+		return []byte{byte(key - tcell.KeyCtrlSpace)}, true
 	}
+	return nil, false
 }
 
 // メイン関数
 func main() {
+	// `serialcon replay <file>` サブコマンドはフラグ体系が異なるため先に振り分ける
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		if err := runReplay(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// コマンドラインオプションの解析
 	var logFilePath string
+	var hexMode bool
+	var recordPath string
+	var scriptPath string
+	var scriptPortName string
+	var scriptBaudRate int
+	var listenAddr string
+	var connectAddr string
 	flag.StringVar(&logFilePath, "log", "", "ログファイルのパス（例: ./logs/session.log）")
+	flag.BoolVar(&hexMode, "hex", false, "受信データをhex.Dump形式（オフセット+16進数+ASCII）で表示する")
+	flag.StringVar(&recordPath, "record", "", "セッションを記録するベースパス。<path>.tc/.tc.timing/.framesを生成する")
+	flag.StringVar(&scriptPath, "script", "", "expect/sendプレイブック(YAML)のパス。指定するとTUIを起動せずヘッドレスで実行する")
+	flag.StringVar(&scriptPortName, "port", "", "-script使用時に接続するポート名（例: /dev/ttyUSB0）")
+	flag.IntVar(&scriptBaudRate, "baud", 0, "-script使用時のボーレート（省略時は9600）")
+	flag.StringVar(&listenAddr, "listen", "", "選択したポートをRFC2217/raw TCPブリッジとして公開するアドレス（例: :2323）")
+	flag.StringVar(&connectAddr, "connect", "", "-listenで公開されたブリッジに接続するクライアントモード（例: host:2323）")
 	flag.Parse()
 
-	// tviewアプリケーションの作成
-	app := tview.NewApplication()
+	// -connectはクライアントモード。ローカルにシリアルポートは不要で、TCP越しに
+	// リモートのブリッジサーバーへ直結したセッションペインを表示する
+	if connectAddr != "" {
+		app := tview.NewApplication()
+		if err := runBridgeClient(app, connectAddr); err != nil {
+			log.Fatalf("接続エラー: %v", err)
+		}
+		if err := app.Run(); err != nil {
+			log.Fatalf("アプリケーションエラー: %v", err)
+		}
+		return
+	}
 
 	// 設定
 	config := DefaultConfig()
 	config.LogFile = logFilePath
+	config.HexMode = hexMode
+	config.RecordPath = recordPath
+	config.ListenAddr = listenAddr
+
+	// -scriptが指定されている場合はTUIを起動せず、プレイブックでポートを駆動して終了する
+	if scriptPath != "" {
+		if scriptPortName == "" {
+			log.Fatalf("-scriptを使用する場合は-portでポートを指定してください")
+		}
+		config.PortName = scriptPortName
+		if scriptBaudRate != 0 {
+			config.BaudRate = scriptBaudRate
+		}
+		if err := runScriptMode(config, scriptPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// tviewアプリケーションの作成
+	app := tview.NewApplication()
 
 	// ログファイルが指定されている場合は表示
 	if config.LogFile != "" {
@@ -407,10 +641,6 @@ func main() {
 		log.Fatalf("ポートの列挙に失敗しました: %v", err)
 	}
 
-	if len(ports) == 0 {
-		log.Fatalf("利用可能なシリアルポートが見つかりませんでした")
-	}
-
 	// メインフォーム
 	form := tview.NewForm()
 
@@ -423,30 +653,60 @@ func main() {
 		portList.AddItem(port, "", rune('a'+i), nil)
 	}
 
+	// ホットプラグで接続/抜線されたデバイスに応じてportListを更新する
+	refreshPortList := func() {
+		updated, err := getAvailablePorts()
+		if err != nil {
+			return
+		}
+		ports = updated
+
+		current := portList.GetCurrentItem()
+		portList.Clear()
+		for i, port := range ports {
+			portList.AddItem(port, "", rune('a'+i%26), nil)
+		}
+		if len(ports) > 0 {
+			if current >= len(ports) {
+				current = len(ports) - 1
+			}
+			portList.SetCurrentItem(current)
+		}
+	}
+	stopWatch := startDeviceWatch(func() {
+		app.QueueUpdateDraw(refreshPortList)
+	})
+
 	portList.SetSelectedFunc(func(index int, _ string, _ string, _ rune) {
+		if index >= len(ports) {
+			return
+		}
+		stopWatch()
+
 		portInfo := ports[index]
 		config.PortName = extractPortName(portInfo)
 
 		// 自動ネゴシエーションが有効な場合
 		if config.AutoNegotiate {
-			app.Stop()
-			fmt.Printf("ポート %s に接続中...\n", config.PortName)
-			fmt.Println("自動ネゴシエーション中...")
-
-			negotiatedConfig, err := autoNegotiate(config.PortName, config)
-			if err != nil {
-				log.Fatalf("自動ネゴシエーションに失敗しました: %v", err)
+			// ネゴシエーションは標準出力に進捗を表示するため、その間だけ
+			// tviewのaltスクリーンを一時的に抜ける（アプリ自体は終了しない）
+			var negotiatedConfig SerialConfig
+			var negotiateErr error
+			app.Suspend(func() {
+				fmt.Printf("ポート %s に接続中...\n", config.PortName)
+				fmt.Println("自動ネゴシエーション中...")
+				negotiatedConfig, negotiateErr = autoNegotiate(config.PortName, config)
+			})
+			if negotiateErr != nil {
+				log.Fatalf("自動ネゴシエーションに失敗しました: %v", negotiateErr)
 			}
 
-			err = connectToPort(negotiatedConfig)
-			if err != nil {
+			if err := connectToPort(app, negotiatedConfig); err != nil {
 				log.Fatalf("接続エラー: %v", err)
 			}
 		} else {
 			// 手動設定の場合
-			app.Stop()
-			err := connectToPort(config)
-			if err != nil {
+			if err := connectToPort(app, config); err != nil {
 				log.Fatalf("接続エラー: %v", err)
 			}
 		}
@@ -494,11 +754,20 @@ func main() {
 			encodingDropDown.SetDisabled(checked)
 		})
 
+	// hexモードチェックボックス（-hexフラグの初期値を反映、セッション中もCtrl-Xで切替可）
+	hexModeCheckbox := tview.NewCheckbox().
+		SetLabel("hexダンプモード: ").
+		SetChecked(config.HexMode).
+		SetChangedFunc(func(checked bool) {
+			config.HexMode = checked
+		})
+
 	// フォームにコンポーネントを追加
 	form.AddFormItem(autoNegotiateCheckbox)
 	form.AddFormItem(autoDetectEncodingCheckbox)
 	form.AddFormItem(baudRateDropDown)
 	form.AddFormItem(encodingDropDown)
+	form.AddFormItem(hexModeCheckbox)
 
 	// レイアウト
 	flex := tview.NewFlex().
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"time"
+)
+
+// フレーム形式のマジックヘッダー（"SCR1"）
+var frameMagic = [4]byte{'S', 'C', 'R', '1'}
+
+// フレームの向き（送受信）
+const (
+	dirRX byte = 0
+	dirTX byte = 1
+)
+
+// sessionRecorder はセッションの送受信を2種類の形式で並行して記録する:
+//   - scriptreplay(1)互換の生バイトストリーム(.tc)とタイミングファイル(.tc.timing)（RXのみ）
+//   - TX/RX双方を含む自己完結フレーム形式(.frames)。マジックヘッダーの後に
+//     {monotonic_ns_delta uint64, direction byte, length uint32, payload []byte} が続く。
+//     replayサブコマンドが読み戻す。
+type sessionRecorder struct {
+	typescript *os.File
+	timing     *os.File
+	frames     *os.File
+
+	lastTime   time.Time
+	lastRXTime time.Time
+}
+
+// newSessionRecorder はbasePathを元にbasePath.tc / basePath.tc.timing / basePath.framesを作成する。
+func newSessionRecorder(basePath string) (*sessionRecorder, error) {
+	typescript, err := os.Create(basePath + ".tc")
+	if err != nil {
+		return nil, fmt.Errorf("typescriptファイルを作成できませんでした: %v", err)
+	}
+
+	timing, err := os.Create(basePath + ".tc.timing")
+	if err != nil {
+		typescript.Close()
+		return nil, fmt.Errorf("timingファイルを作成できませんでした: %v", err)
+	}
+
+	frames, err := os.Create(basePath + ".frames")
+	if err != nil {
+		typescript.Close()
+		timing.Close()
+		return nil, fmt.Errorf("framesファイルを作成できませんでした: %v", err)
+	}
+	if _, err := frames.Write(frameMagic[:]); err != nil {
+		typescript.Close()
+		timing.Close()
+		frames.Close()
+		return nil, fmt.Errorf("framesファイルへの書き込みに失敗しました: %v", err)
+	}
+
+	now := time.Now()
+	fmt.Fprintf(typescript, "Script started on %s\n", now.Format(time.RFC1123))
+
+	return &sessionRecorder{typescript: typescript, timing: timing, frames: frames, lastTime: now, lastRXTime: now}, nil
+}
+
+// RecordRX は受信データを記録する（scriptreplay互換ファイルとフレーム形式の両方）。
+func (r *sessionRecorder) RecordRX(data []byte) {
+	r.record(dirRX, data)
+}
+
+// RecordTX は送信データを記録する（フレーム形式のみ。typescriptはRXの見た目を再現するため）。
+func (r *sessionRecorder) RecordTX(data []byte) {
+	r.record(dirTX, data)
+}
+
+func (r *sessionRecorder) record(dir byte, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	now := time.Now()
+	delta := now.Sub(r.lastTime)
+	if delta < 0 {
+		delta = 0
+	}
+	r.lastTime = now
+
+	var header [13]byte
+	binary.BigEndian.PutUint64(header[0:8], uint64(delta.Nanoseconds()))
+	header[8] = dir
+	binary.BigEndian.PutUint32(header[9:13], uint32(len(data)))
+	r.frames.Write(header[:])
+	r.frames.Write(data)
+
+	if dir == dirRX {
+		rxDelta := now.Sub(r.lastRXTime)
+		if rxDelta < 0 {
+			rxDelta = 0
+		}
+		r.lastRXTime = now
+
+		r.typescript.Write(data)
+		fmt.Fprintf(r.timing, "%.6f %d\n", rxDelta.Seconds(), len(data))
+	}
+}
+
+// Close はすべての記録ファイルを閉じる。
+func (r *sessionRecorder) Close() error {
+	fmt.Fprintf(r.typescript, "\nScript done on %s\n", time.Now().Format(time.RFC1123))
+	r.typescript.Close()
+	r.timing.Close()
+	return r.frames.Close()
+}
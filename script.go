@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.bug.st/serial"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+	"gopkg.in/yaml.v3"
+)
+
+// デフォルトのexpectタイムアウト（ステップ側で指定がない場合）
+const defaultExpectTimeout = 10 * time.Second
+
+// Playbook は-scriptで読み込むYAMLプレイブック全体を表す。
+type Playbook struct {
+	Steps []PlaybookStep `yaml:"steps"`
+}
+
+// PlaybookStep はexpect/send/set-baud/sleep/log-markのいずれか一つを持つ1ステップ。
+// どのフィールドが埋まっているかでステップ種別を判定する。
+type PlaybookStep struct {
+	Expect  *ExpectSpec `yaml:"expect,omitempty"`
+	Send    *SendSpec   `yaml:"send,omitempty"`
+	SetBaud int         `yaml:"set-baud,omitempty"`
+	Sleep   string      `yaml:"sleep,omitempty"`
+	LogMark string      `yaml:"log-mark,omitempty"`
+	Timeout string      `yaml:"timeout,omitempty"` // expectステップのタイムアウト（例: "5s"）
+}
+
+// ExpectSpec はexpectステップの条件。Regexが指定されていれば正規表現マッチ、
+// そうでなければLiteralを部分一致で照合する。
+type ExpectSpec struct {
+	Regex   string
+	Literal string
+}
+
+// UnmarshalYAML は `expect: "login:"` のようなスカラー指定をLiteralとして、
+// `expect: {regex: "..."}`をRegexとして解釈する。
+func (e *ExpectSpec) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		e.Literal = node.Value
+		return nil
+	}
+	var m struct {
+		Regex string `yaml:"regex"`
+	}
+	if err := node.Decode(&m); err != nil {
+		return err
+	}
+	e.Regex = m.Regex
+	return nil
+}
+
+// SendSpec はsendステップの内容。Hexが指定されていればバイト列に変換して送信し、
+// それ以外はLiteral文字列（直前のexpectで捕捉したグループの置換込み）を送信する。
+type SendSpec struct {
+	Literal string
+	Hex     string
+}
+
+// UnmarshalYAML は `send: "foo\n"` をLiteralとして、`send: {hex: "3f 0d"}`をHexとして解釈する。
+func (s *SendSpec) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		s.Literal = node.Value
+		return nil
+	}
+	var m struct {
+		Hex string `yaml:"hex"`
+	}
+	if err := node.Decode(&m); err != nil {
+		return err
+	}
+	s.Hex = m.Hex
+	return nil
+}
+
+// loadPlaybook はYAMLファイルを読み込みPlaybookにパースする。
+func loadPlaybook(path string) (*Playbook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("プレイブックを読み込めませんでした: %v", err)
+	}
+	var pb Playbook
+	if err := yaml.Unmarshal(data, &pb); err != nil {
+		return nil, fmt.Errorf("プレイブックの解析に失敗しました: %v", err)
+	}
+	return &pb, nil
+}
+
+// scriptRunner はYAMLプレイブックに従ってシリアルポートをexpect/sendで駆動する。
+// インタラクティブセッションと同じdecodeChunkでデコードするため、エンコーディングの
+// 扱いが両者で一致する。ANSIエスケープは照合前にstripANSIで取り除く（セッションペイン
+// のほうはこれを取り除かず、装飾として解釈する）。
+type scriptRunner struct {
+	port        serial.Port
+	transformer transform.Transformer
+	logFile     *os.File
+	captures    []string
+}
+
+func newScriptRunner(port serial.Port, transformer transform.Transformer, logFile *os.File) *scriptRunner {
+	return &scriptRunner{port: port, transformer: transformer, logFile: logFile}
+}
+
+func (r *scriptRunner) logf(format string, args ...interface{}) {
+	line := fmt.Sprintf(format, args...)
+	fmt.Println(line)
+	if r.logFile != nil {
+		r.logFile.WriteString(line + "\n")
+	}
+}
+
+// run はプレイブックを最初から順に実行する。expectがタイムアウトした場合は
+// エラーを返す（呼び出し元が非ゼロ終了コードにマッピングする）。
+func (r *scriptRunner) run(pb *Playbook) error {
+	for i, step := range pb.Steps {
+		start := time.Now()
+
+		switch {
+		case step.Expect != nil:
+			timeout := defaultExpectTimeout
+			if step.Timeout != "" {
+				if d, err := time.ParseDuration(step.Timeout); err == nil {
+					timeout = d
+				}
+			}
+			err := r.doExpect(step.Expect, timeout)
+			r.logf("[%d] expect (%s) -> %v (%s)", i+1, describeExpect(step.Expect), err == nil, time.Since(start))
+			if err != nil {
+				return fmt.Errorf("ステップ%d: %v", i+1, err)
+			}
+		case step.Send != nil:
+			if err := r.doSend(step.Send); err != nil {
+				return fmt.Errorf("ステップ%d: 送信に失敗しました: %v", i+1, err)
+			}
+			r.logf("[%d] send (%s) (%s)", i+1, describeSend(step.Send), time.Since(start))
+		case step.SetBaud != 0:
+			if err := r.port.SetMode(&serial.Mode{BaudRate: step.SetBaud}); err != nil {
+				return fmt.Errorf("ステップ%d: ボーレート変更に失敗しました: %v", i+1, err)
+			}
+			r.logf("[%d] set-baud %d", i+1, step.SetBaud)
+		case step.Sleep != "":
+			d, err := time.ParseDuration(step.Sleep)
+			if err != nil {
+				return fmt.Errorf("ステップ%d: sleepの指定が不正です: %v", i+1, err)
+			}
+			time.Sleep(d)
+			r.logf("[%d] sleep %s", i+1, step.Sleep)
+		case step.LogMark != "":
+			r.logf("[%d] log-mark: %s", i+1, step.LogMark)
+		}
+	}
+	return nil
+}
+
+// doExpect はタイムアウトまでポートを読み続け、spec（正規表現または部分文字列）に
+// 一致したら捕捉グループをr.capturesに記録して返る。一致しないままタイムアウトすると
+// エラーを返す。
+func (r *scriptRunner) doExpect(spec *ExpectSpec, timeout time.Duration) error {
+	var re *regexp.Regexp
+	if spec.Regex != "" {
+		var err error
+		re, err = regexp.Compile(spec.Regex)
+		if err != nil {
+			return fmt.Errorf("正規表現が不正です: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+	r.port.SetReadTimeout(100 * time.Millisecond)
+
+	var buf strings.Builder
+	readBuf := make([]byte, 1024)
+
+	for time.Now().Before(deadline) {
+		n, err := r.port.Read(readBuf)
+		if err != nil && !strings.Contains(err.Error(), "timeout") {
+			return err
+		}
+		if n > 0 {
+			buf.Write(decodeChunk(readBuf[:n], r.transformer))
+		}
+
+		text := stripANSI(buf.String())
+		if re != nil {
+			if m := re.FindStringSubmatch(text); m != nil {
+				r.captures = m
+				return nil
+			}
+		} else if spec.Literal != "" && strings.Contains(text, spec.Literal) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("タイムアウトしました（%s待機）: %s", timeout, describeExpect(spec))
+}
+
+// doSend はspecに従ってバイト列を組み立て、ポートに書き込む。Literal側は
+// 直前のexpectで捕捉したグループを ${1}, ${2}... で埋め込める。
+func (r *scriptRunner) doSend(spec *SendSpec) error {
+	var data []byte
+	if spec.Hex != "" {
+		cleaned := strings.ReplaceAll(spec.Hex, " ", "")
+		b, err := hex.DecodeString(cleaned)
+		if err != nil {
+			return fmt.Errorf("hexの指定が不正です: %v", err)
+		}
+		data = b
+	} else {
+		data = []byte(r.substituteCaptures(spec.Literal))
+	}
+
+	_, err := r.port.Write(data)
+	return err
+}
+
+// substituteCaptures は ${0}, ${1}, ... を直前のexpectで捕捉したグループに置き換える。
+func (r *scriptRunner) substituteCaptures(s string) string {
+	for i, group := range r.captures {
+		s = strings.ReplaceAll(s, fmt.Sprintf("${%d}", i), group)
+	}
+	return s
+}
+
+func describeExpect(e *ExpectSpec) string {
+	if e.Regex != "" {
+		return "regex: " + e.Regex
+	}
+	return "literal: " + e.Literal
+}
+
+func describeSend(s *SendSpec) string {
+	if s.Hex != "" {
+		return "hex: " + s.Hex
+	}
+	return s.Literal
+}
+
+// runScriptMode はTUIを起動せず、指定ポートをプレイブックで駆動する。CIからの
+// 自動プロビジョニング用途を想定し、戻り値のエラーはそのまま呼び出し元で
+// 非ゼロ終了コードに変換される。
+func runScriptMode(config SerialConfig, scriptPath string) error {
+	pb, err := loadPlaybook(scriptPath)
+	if err != nil {
+		return err
+	}
+
+	port, err := serial.Open(config.PortName, &serial.Mode{
+		BaudRate: config.BaudRate,
+		DataBits: config.DataBits,
+		Parity:   config.Parity,
+		StopBits: config.StopBits,
+	})
+	if err != nil {
+		return fmt.Errorf("ポートを開けませんでした: %v", err)
+	}
+	defer port.Close()
+
+	var logFile *os.File
+	if config.LogFile != "" {
+		logDir := filepath.Dir(config.LogFile)
+		if logDir != "." {
+			if err := os.MkdirAll(logDir, 0755); err != nil {
+				return fmt.Errorf("ログディレクトリの作成に失敗しました: %v", err)
+			}
+		}
+		logFile, err = os.OpenFile(config.LogFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("ログファイルを開けませんでした: %v", err)
+		}
+		defer logFile.Close()
+	}
+
+	var transformer transform.Transformer
+	if config.Encoding != encoding.Nop {
+		transformer = config.Encoding.NewDecoder()
+	}
+
+	runner := newScriptRunner(port, transformer, logFile)
+	return runner.run(pb)
+}
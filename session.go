@@ -0,0 +1,360 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// セッションのスクロールバックに保持する行数
+const scrollbackLines = 5000
+
+// セッション表示モード
+type sessionMode int
+
+const (
+	// 常に最新の出力を表示する（通常時）
+	modeLiveTail sessionMode = iota
+	// tmuxのコピーモードのように過去ログをスクロールして閲覧する
+	modeScroll
+)
+
+// 1文字分の表示情報（文字と現在のSGR装飾）
+type termCell struct {
+	ch    rune
+	style tcell.Style
+}
+
+// sessionPane はシリアルポートのセッションを描画するtviewプリミティブ。
+// ANSI/VT100のSGRエスケープやCR/LF/BS/ESC[Kを解釈し、スクロールバックを保持する。
+type sessionPane struct {
+	*tview.TextView
+
+	mu sync.Mutex
+
+	scrollback []string // 確定済みの行（tviewのカラータグ付きテキスト）
+	current    []termCell
+	col        int
+	curStyle   tcell.Style
+
+	// VT100エスケープシーケンスの途中状態
+	parsing bool
+	params  string
+	fe      bool // ESC直後で '[' 待ち
+
+	mode      sessionMode
+	searchBar *tview.InputField
+
+	app *tview.Application
+}
+
+// newSessionPane は空のセッションペインを作成する。
+func newSessionPane(app *tview.Application) *sessionPane {
+	p := &sessionPane{
+		TextView: tview.NewTextView().
+			SetDynamicColors(true).
+			SetScrollable(true).
+			SetWrap(false),
+		curStyle: tcell.StyleDefault,
+		mode:     modeLiveTail,
+		app:      app,
+	}
+	p.SetBorder(true).SetTitle(" セッション (Ctrl-B: live/scroll切替, Ctrl-X: hexダンプ切替) ")
+	return p
+}
+
+// Write はシリアルポートから読み込んだ生データ（デコード済みまたはhexダンプ済み）を
+// 端末バッファに取り込み、画面を更新する。io.Writerを満たすために用意している。
+func (p *sessionPane) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	p.feed(string(data))
+	p.mu.Unlock()
+
+	if p.app != nil {
+		p.app.QueueUpdateDraw(func() {
+			p.redraw()
+		})
+	} else {
+		p.redraw()
+	}
+	return len(data), nil
+}
+
+// feed は1文字（rune）ずつ端末バッファに反映する。呼び出し側でmuを保持していること。
+func (p *sessionPane) feed(s string) {
+	for _, r := range s {
+		p.feedRune(r)
+	}
+}
+
+func (p *sessionPane) feedRune(r rune) {
+	if p.parsing {
+		p.feedEscape(r)
+		return
+	}
+
+	switch r {
+	case 0x1b: // ESC
+		p.parsing = true
+		p.fe = true
+		p.params = ""
+	case '\r':
+		p.col = 0
+	case '\n':
+		p.commitLine()
+	case '\b':
+		if p.col > 0 {
+			p.col--
+		}
+	default:
+		p.putRune(r)
+	}
+}
+
+// feedEscape はESC開始後のシーケンスを解釈する。現状はCSI（ESC [ ... 文字）のみ対応。
+func (p *sessionPane) feedEscape(r rune) {
+	if p.fe {
+		if r == '[' {
+			p.fe = false
+			return
+		}
+		// CSI以外のエスケープは無視して終了
+		p.parsing = false
+		p.fe = false
+		return
+	}
+
+	if (r >= '0' && r <= '9') || r == ';' {
+		p.params += string(r)
+		return
+	}
+
+	// 最終文字（コマンド）
+	switch r {
+	case 'm':
+		p.applySGR(p.params)
+	case 'K':
+		p.clearToEndOfLine(p.params)
+	}
+	p.parsing = false
+	p.params = ""
+}
+
+// clearToEndOfLine はESC[Kを処理する。0=カーソルから行末、1=行頭からカーソル、2=行全体。
+func (p *sessionPane) clearToEndOfLine(params string) {
+	switch params {
+	case "1":
+		for i := 0; i < p.col && i < len(p.current); i++ {
+			p.current[i] = termCell{ch: ' ', style: p.curStyle}
+		}
+	case "2":
+		p.current = p.current[:0]
+	default:
+		if p.col < len(p.current) {
+			p.current = p.current[:p.col]
+		}
+	}
+}
+
+// applySGR はSGR (Select Graphic Rendition) パラメータをtcell.Styleに反映する。
+func (p *sessionPane) applySGR(params string) {
+	if params == "" {
+		params = "0"
+	}
+
+	style := p.curStyle
+	for _, part := range strings.Split(params, ";") {
+		switch part {
+		case "", "0":
+			style = tcell.StyleDefault
+		case "1":
+			style = style.Bold(true)
+		case "4":
+			style = style.Underline(true)
+		case "7":
+			style = style.Reverse(true)
+		case "22":
+			style = style.Bold(false)
+		case "24":
+			style = style.Underline(false)
+		case "27":
+			style = style.Reverse(false)
+		case "30", "31", "32", "33", "34", "35", "36", "37":
+			style = style.Foreground(ansiColor(part, false))
+		case "40", "41", "42", "43", "44", "45", "46", "47":
+			style = style.Background(ansiColor(part, true))
+		case "39":
+			style = style.Foreground(tcell.ColorDefault)
+		case "49":
+			style = style.Background(tcell.ColorDefault)
+		}
+	}
+	p.curStyle = style
+}
+
+// ansiColor はSGRの色番号(30-37/40-47)をtcell.Colorに変換する。
+func ansiColor(code string, background bool) tcell.Color {
+	base := map[string]tcell.Color{
+		"0": tcell.ColorBlack,
+		"1": tcell.ColorMaroon,
+		"2": tcell.ColorGreen,
+		"3": tcell.ColorOlive,
+		"4": tcell.ColorNavy,
+		"5": tcell.ColorPurple,
+		"6": tcell.ColorTeal,
+		"7": tcell.ColorSilver,
+	}
+	n := code
+	if background {
+		n = fmt.Sprintf("%d", atoiSafe(code)-40)
+	} else {
+		n = fmt.Sprintf("%d", atoiSafe(code)-30)
+	}
+	if c, ok := base[n]; ok {
+		return c
+	}
+	return tcell.ColorDefault
+}
+
+func atoiSafe(s string) int {
+	n := 0
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return n
+		}
+		n = n*10 + int(r-'0')
+	}
+	return n
+}
+
+func (p *sessionPane) putRune(r rune) {
+	cell := termCell{ch: r, style: p.curStyle}
+	if p.col < len(p.current) {
+		p.current[p.col] = cell
+	} else {
+		for len(p.current) < p.col {
+			p.current = append(p.current, termCell{ch: ' ', style: p.curStyle})
+		}
+		p.current = append(p.current, cell)
+	}
+	p.col++
+}
+
+// commitLine は現在編集中の行をスクロールバックに確定する。
+func (p *sessionPane) commitLine() {
+	p.scrollback = append(p.scrollback, renderLine(p.current))
+	if len(p.scrollback) > scrollbackLines {
+		p.scrollback = p.scrollback[len(p.scrollback)-scrollbackLines:]
+	}
+	p.current = p.current[:0]
+	p.col = 0
+}
+
+// renderLine はtermCellの列をtviewのダイナミックカラータグ付き文字列に変換する。
+func renderLine(cells []termCell) string {
+	var b strings.Builder
+	var lastStyle tcell.Style
+	first := true
+	for _, c := range cells {
+		if first || c.style != lastStyle {
+			b.WriteString(styleTag(c.style))
+			lastStyle = c.style
+			first = false
+		}
+		b.WriteString(tview.Escape(string(c.ch)))
+	}
+	return b.String()
+}
+
+// styleTag はtcell.Styleをtviewの "[fg:bg:attr]" タグ表記に変換する。
+func styleTag(s tcell.Style) string {
+	fg, bg, attr := s.Decompose()
+	attrStr := ""
+	if attr&tcell.AttrBold != 0 {
+		attrStr += "b"
+	}
+	if attr&tcell.AttrUnderline != 0 {
+		attrStr += "u"
+	}
+	if attr&tcell.AttrReverse != 0 {
+		attrStr += "r"
+	}
+	if attrStr == "" {
+		attrStr = "-"
+	}
+	return fmt.Sprintf("[%s:%s:%s]", colorName(fg), colorName(bg), attrStr)
+}
+
+func colorName(c tcell.Color) string {
+	if c == tcell.ColorDefault {
+		return "-"
+	}
+	return fmt.Sprintf("#%06x", c.Hex())
+}
+
+// redraw はスクロールバックと現在行をTextViewに反映する。muはこの関数内で取得するため、呼び出し側で保持していてはならない。
+func (p *sessionPane) redraw() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var b strings.Builder
+	for _, line := range p.scrollback {
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	b.WriteString(renderLine(p.current))
+
+	p.SetText(b.String())
+	if p.mode == modeLiveTail {
+		p.ScrollToEnd()
+	}
+}
+
+// setMode はライブテール/スクロールモードを切り替える。
+func (p *sessionPane) setMode(m sessionMode) {
+	p.mu.Lock()
+	p.mode = m
+	p.mu.Unlock()
+
+	title := " セッション (Ctrl-B: live/scroll切替, Ctrl-X: hexダンプ切替) "
+	if m == modeScroll {
+		title = " セッション [スクロールモード] (Ctrl-B: 戻る, PgUp/PgDn, /: 検索) "
+		p.ScrollToEnd()
+	}
+	p.SetTitle(title)
+}
+
+// setConnected はデバイスの抜線・再接続をタイトルに反映する。切断中でもスクロールバックは保持される。
+func (p *sessionPane) setConnected(connected bool, portName string) {
+	if connected {
+		p.SetTitle(fmt.Sprintf(" セッション: %s (Ctrl-B: live/scroll切替, Ctrl-X: hexダンプ切替) ", portName))
+		return
+	}
+	p.SetTitle(fmt.Sprintf(" セッション: %s [切断 - 再接続待機中] ", portName))
+}
+
+func (p *sessionPane) toggleMode() {
+	if p.mode == modeLiveTail {
+		p.setMode(modeScroll)
+	} else {
+		p.setMode(modeLiveTail)
+	}
+}
+
+// search は現在のスクロールバックを末尾（最新の行）から遡って探し、クエリに最初に一致した行にジャンプする。
+func (p *sessionPane) search(query string) {
+	if query == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := len(p.scrollback) - 1; i >= 0; i-- {
+		if strings.Contains(p.scrollback[i], query) {
+			p.ScrollTo(i, 0)
+			return
+		}
+	}
+}